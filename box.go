@@ -6,12 +6,12 @@ import (
 	"io"
 	"os"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/sagernet/sing-box/adapter"
 	"github.com/sagernet/sing-box/experimental"
 	"github.com/sagernet/sing-box/experimental/libbox/platform"
-	"github.com/sagernet/sing-box/inbound"
 	"github.com/sagernet/sing-box/log"
 	"github.com/sagernet/sing-box/option"
 	"github.com/sagernet/sing-box/outbound"
@@ -26,16 +26,22 @@ import (
 var _ adapter.Service = (*Box)(nil)
 
 type Box struct {
-	createdAt    time.Time
-	router       adapter.Router
-	inbounds     []adapter.Inbound
-	outbounds    []adapter.Outbound
-	logFactory   log.Factory
-	logger       log.ContextLogger
-	preServices  map[string]adapter.Service
-	postServices map[string]adapter.Service
-	scripts      []*script.ScriptService
-	done         chan struct{}
+	createdAt      time.Time
+	options        option.Options
+	router         adapter.Router
+	trackedRouter  *trackedRouter
+	inbounds       []adapter.Inbound
+	outbounds      []adapter.Outbound
+	proxyProviders []adapter.ProxyProvider
+	outboundGraph  *outboundGraph
+	logFactory     log.Factory
+	logger         log.ContextLogger
+	preServices    map[string]adapter.Service
+	postServices   map[string]adapter.Service
+	scripts        []*script.ScriptService
+	done           chan struct{}
+	pauseAccess    sync.Mutex
+	paused         bool
 }
 
 type Options struct {
@@ -51,7 +57,11 @@ func New(options Options) (*Box, error) {
 	}
 	createdAt := time.Now()
 	experimentalOptions := common.PtrValueOrDefault(options.Experimental)
-	applyDebugOptions(common.PtrValueOrDefault(experimentalOptions.Debug))
+	debugOptions := common.PtrValueOrDefault(experimentalOptions.Debug)
+	if platformDebug, isPlatformDebug := options.PlatformInterface.(PlatformDebugOptions); isPlatformDebug {
+		debugOptions = mergeDebugOptions(debugOptions, platformDebug.DebugOptions())
+	}
+	applyDebugOptions(debugOptions)
 	var needClashAPI bool
 	var needV2RayAPI bool
 	if experimentalOptions.ClashAPI != nil && experimentalOptions.ClashAPI.ExternalController != "" {
@@ -88,6 +98,11 @@ func New(options Options) (*Box, error) {
 	if err != nil {
 		return nil, E.Cause(err, "parse route options")
 	}
+	outboundGraph, err := newOutboundGraph(options.Outbounds)
+	if err != nil {
+		return nil, E.Cause(err, "parse outbound options")
+	}
+	trackedRouter := newTrackedRouter(router, logger)
 	inbounds := make([]adapter.Inbound, 0, len(options.Inbounds))
 	outbounds := make([]adapter.Outbound, 0, len(options.Outbounds))
 	for i, inboundOptions := range options.Inbounds {
@@ -98,9 +113,9 @@ func New(options Options) (*Box, error) {
 		} else {
 			tag = F.ToString(i)
 		}
-		in, err = inbound.New(
+		in, err = newInbound(
 			ctx,
-			router,
+			trackedRouter,
 			logFactory.NewLogger(F.ToString("inbound/", inboundOptions.Type, "[", tag, "]")),
 			inboundOptions,
 			options.PlatformInterface,
@@ -118,7 +133,7 @@ func New(options Options) (*Box, error) {
 		} else {
 			tag = F.ToString(i)
 		}
-		out, err = outbound.New(
+		out, err = newOutbound(
 			ctx,
 			router,
 			logFactory.NewLogger(F.ToString("outbound/", outboundOptions.Type, "[", tag, "]")),
@@ -131,6 +146,7 @@ func New(options Options) (*Box, error) {
 	}
 	var proxyProviders []adapter.ProxyProvider
 	var proxyProviderOutbounds map[string][]adapter.Outbound
+	var externalTags []string
 	if options.ProxyProviders != nil && len(options.ProxyProviders) > 0 {
 		proxyProviders = make([]adapter.ProxyProvider, 0)
 		proxyProviderOutbounds = make(map[string][]adapter.Outbound)
@@ -150,10 +166,26 @@ func New(options Options) (*Box, error) {
 			}
 			outbounds = append(outbounds, outs...)
 			proxyProviderOutbounds[pp.Tag()] = outs
+			externalTags = append(externalTags, pp.Tag())
+			for _, out := range outs {
+				externalTags = append(externalTags, out.Tag())
+			}
 			proxyProviders = append(proxyProviders, pp)
 			logger.Info("init proxy provider[", i, "]", " done")
 		}
 	}
+	err = outboundGraph.Validate(externalTags)
+	if err != nil {
+		return nil, E.Cause(err, "validate outbounds")
+	}
+	if options.DNS != nil {
+		err = validateDNSServers(logger, options.DNS.Servers, func(tag string) bool {
+			return outboundGraph.nodeByTag[tag] != nil || common.Contains(externalTags, tag)
+		})
+		if err != nil {
+			return nil, E.Cause(err, "validate dns servers")
+		}
+	}
 	err = router.Initialize(inbounds, outbounds, proxyProviders, proxyProviderOutbounds, func() adapter.Outbound {
 		out, oErr := outbound.New(ctx, router, logFactory.NewLogger("outbound/direct"), "direct", option.Outbound{Type: "direct", Tag: "default"})
 		common.Must(oErr)
@@ -205,16 +237,20 @@ func New(options Options) (*Box, error) {
 	}
 
 	return &Box{
-		router:       router,
-		inbounds:     inbounds,
-		outbounds:    outbounds,
-		createdAt:    createdAt,
-		logFactory:   logFactory,
-		logger:       logger,
-		preServices:  preServices,
-		postServices: postServices,
-		scripts:      scripts,
-		done:         make(chan struct{}),
+		options:        options.Options,
+		router:         router,
+		trackedRouter:  trackedRouter,
+		inbounds:       inbounds,
+		outbounds:      outbounds,
+		proxyProviders: proxyProviders,
+		outboundGraph:  outboundGraph,
+		createdAt:      createdAt,
+		logFactory:     logFactory,
+		logger:         logger,
+		preServices:    preServices,
+		postServices:   postServices,
+		scripts:        scripts,
+		done:           make(chan struct{}),
 	}, nil
 }
 
@@ -280,7 +316,11 @@ func (s *Box) preStart() error {
 			return E.Cause(err, "pre-starting ", serviceName)
 		}
 	}
-	for i, out := range s.outbounds {
+	outbounds, err := s.outboundStartOrder()
+	if err != nil {
+		return err
+	}
+	for i, out := range outbounds {
 		var tag string
 		if out.Tag() == "" {
 			tag = F.ToString(i)
@@ -298,6 +338,23 @@ func (s *Box) preStart() error {
 	return s.router.Start()
 }
 
+// outboundStartOrder returns outbounds created outside the options, such as
+// proxy provider nodes and the default outbound, followed by configured
+// outbounds sorted so that detours and group members start first.
+func (s *Box) outboundStartOrder() ([]adapter.Outbound, error) {
+	order, err := s.outboundGraph.Order()
+	if err != nil {
+		return nil, err
+	}
+	configured := len(s.outboundGraph.nodes)
+	outbounds := make([]adapter.Outbound, 0, len(s.outbounds))
+	outbounds = append(outbounds, s.outbounds[configured:]...)
+	for _, index := range order {
+		outbounds = append(outbounds, s.outbounds[index])
+	}
+	return outbounds, nil
+}
+
 func (s *Box) start() error {
 	err := s.preStart()
 	if err != nil {
@@ -352,6 +409,19 @@ func (s *Box) start() error {
 }
 
 func (s *Box) Close() error {
+	return s.close(nil)
+}
+
+// Shutdown stops accepting new connections, waits until active connections
+// finish or ctx is done, then closes the box like Close. Packet sessions
+// sharing a listener with the inbound end when the inbound is closed.
+// Connections still active when ctx is done are not closed by Shutdown and
+// are left to fail once their outbounds are closed.
+func (s *Box) Shutdown(ctx context.Context) error {
+	return s.close(ctx)
+}
+
+func (s *Box) close(drainCtx context.Context) error {
 	select {
 	case <-s.done:
 		return os.ErrClosed
@@ -389,6 +459,9 @@ func (s *Box) Close() error {
 			return E.Cause(err, "close inbound/", in.Type(), "[", i, "]")
 		})
 	}
+	if drainCtx != nil {
+		s.drainConnections(drainCtx)
+	}
 	for i, out := range s.outbounds {
 		s.logger.Trace("closing outbound/", out.Type(), "[", i, "]")
 		errors = E.Append(errors, common.Close(out), func(err error) error {
@@ -434,6 +507,28 @@ func (s *Box) Close() error {
 	return errors
 }
 
+func (s *Box) drainConnections(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastConnections int64
+	for {
+		connections := s.trackedRouter.Connections()
+		if connections == 0 {
+			return
+		}
+		if connections != lastConnections {
+			s.logger.Info("waiting for ", connections, " active connections")
+			lastConnections = connections
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Warn("drain timeout, abandoning ", connections, " active connections")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *Box) Router() adapter.Router {
 	return s.router
 }
@@ -0,0 +1,275 @@
+package box
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/sagernet/sing-box/common/json"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+)
+
+// ValidationError is a single problem found by Check, located by the JSON
+// path of the offending option, e.g. "route.rules[2].outbound".
+type ValidationError struct {
+	Path string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned by Check and lists every problem found.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	return strings.Join(common.Map(e, func(it *ValidationError) string {
+		return it.Error()
+	}), "\n")
+}
+
+type checker struct {
+	errors ValidationErrors
+}
+
+func (c *checker) add(path string, err error) {
+	c.errors = append(c.errors, &ValidationError{Path: path, Err: err})
+}
+
+func (c *checker) addf(path string, message ...any) {
+	c.add(path, E.New(message...))
+}
+
+// Check performs semantic validation of options without creating any
+// component. Outbound references can not be resolved before proxy providers
+// are fetched, so they are only checked when no proxy provider is configured.
+func Check(options Options) error {
+	c := &checker{}
+	graph := c.checkOutbounds(options.Outbounds)
+	outboundExists := func(tag string) bool {
+		return len(options.ProxyProviders) > 0 || graph.nodeByTag[tag] != nil
+	}
+	for _, node := range graph.nodes {
+		for _, dependency := range node.dependencies {
+			if !outboundExists(dependency.tag) {
+				c.addf(F.ToString("outbounds[", node.index, "].", dependency.path()), "outbound not found: ", dependency.tag)
+			}
+		}
+	}
+	c.checkInbounds(options.Inbounds)
+	if options.Route != nil {
+		c.checkRoute(*options.Route, outboundExists)
+	}
+	if options.DNS != nil {
+		c.checkDNS(*options.DNS, outboundExists)
+	}
+	if len(c.errors) > 0 {
+		return c.errors
+	}
+	return nil
+}
+
+// Format returns the indented JSON form of options. Inbounds and outbounds
+// of registered types are written with their type and tag only.
+func Format(options option.Options) ([]byte, error) {
+	return encodeOptions(options, nil, false)
+}
+
+func (c *checker) checkOutbounds(outbounds []option.Outbound) *outboundGraph {
+	graph := &outboundGraph{
+		nodeByTag: make(map[string]*outboundNode),
+	}
+	for i, outboundOptions := range outbounds {
+		path := F.ToString("outbounds[", i, "]")
+		tag := outboundTag(outboundOptions, i)
+		if graph.nodeByTag[tag] != nil {
+			c.addf(path+".tag", "duplicate outbound tag: ", tag)
+			continue
+		}
+		err := graph.add(i, outboundOptions)
+		if err != nil {
+			c.add(path, err)
+		}
+	}
+	err := graph.visit(func(*outboundNode) {})
+	if cycleErr, isCycle := err.(*outboundCycleError); isCycle {
+		c.add(F.ToString("outbounds[", cycleErr.node.index, "]"), cycleErr)
+	} else if err != nil {
+		c.add("outbounds", err)
+	}
+	return graph
+}
+
+type listenEntry struct {
+	path    string
+	address netip.Addr
+}
+
+func (c *checker) checkInbounds(inbounds []option.Inbound) {
+	tags := make(map[string]bool)
+	listeners := make(map[string][]listenEntry)
+	for i, inboundOptions := range inbounds {
+		path := F.ToString("inbounds[", i, "]")
+		if inboundOptions.Tag != "" {
+			if tags[inboundOptions.Tag] {
+				c.addf(path+".tag", "duplicate inbound tag: ", inboundOptions.Tag)
+			}
+			tags[inboundOptions.Tag] = true
+		}
+		if isRegisteredInbound(inboundOptions.Type) {
+			continue
+		}
+		content, err := json.Marshal(inboundOptions)
+		if err != nil {
+			c.add(path, err)
+			continue
+		}
+		var object map[string]any
+		err = json.Unmarshal(content, &object)
+		if err != nil {
+			c.add(path, err)
+			continue
+		}
+		listenPort, _ := object["listen_port"].(float64)
+		if listenPort == 0 {
+			continue
+		}
+		address := netip.IPv6Unspecified()
+		if listen, isString := object["listen"].(string); isString && listen != "" {
+			address, err = netip.ParseAddr(listen)
+			if err != nil {
+				c.add(path+".listen", err)
+				continue
+			}
+		}
+		network, _ := object["network"].(string)
+		for _, networkName := range inboundNetworks(inboundOptions.Type, network) {
+			key := F.ToString(networkName, "/", uint16(listenPort))
+			entry := listenEntry{path, address}
+			for _, other := range listeners[key] {
+				if other.address == address || other.address.IsUnspecified() || address.IsUnspecified() {
+					c.addf(path+".listen_port", networkName, " port ", uint16(listenPort), " already used by ", other.path)
+					break
+				}
+			}
+			listeners[key] = append(listeners[key], entry)
+		}
+	}
+}
+
+func inboundNetworks(inboundType string, network string) []string {
+	switch network {
+	case "tcp", "udp":
+		return []string{network}
+	}
+	switch inboundType {
+	case C.TypeHysteria, C.TypeTUIC:
+		return []string{"udp"}
+	case C.TypeDirect, C.TypeShadowsocks, C.TypeTProxy, C.TypeNaive:
+		return []string{"tcp", "udp"}
+	default:
+		return []string{"tcp"}
+	}
+}
+
+func (c *checker) checkRoute(options option.RouteOptions, outboundExists func(tag string) bool) {
+	for i, rule := range options.Rules {
+		path := F.ToString("route.rules[", i, "]")
+		var outbound string
+		switch rule.Type {
+		case "", C.RuleTypeDefault:
+			c.checkDefaultRule(path, rule.DefaultOptions)
+			outbound = rule.DefaultOptions.Outbound
+		case C.RuleTypeLogical:
+			for j, subRule := range rule.LogicalOptions.Rules {
+				c.checkDefaultRule(F.ToString(path, ".rules[", j, "]"), subRule)
+			}
+			outbound = rule.LogicalOptions.Outbound
+		default:
+			c.addf(path+".type", "unknown rule type: ", rule.Type)
+			continue
+		}
+		if outbound == "" {
+			c.addf(path+".outbound", "missing outbound")
+		} else if !outboundExists(outbound) {
+			c.addf(path+".outbound", "outbound not found: ", outbound)
+		}
+	}
+	if options.Final != "" && !outboundExists(options.Final) {
+		c.addf("route.final", "outbound not found: ", options.Final)
+	}
+}
+
+func (c *checker) checkDefaultRule(path string, rule option.DefaultRule) {
+	c.checkCIDR(path+".ip_cidr", rule.IPCIDR)
+	c.checkCIDR(path+".source_ip_cidr", rule.SourceIPCIDR)
+}
+
+func (c *checker) checkDNS(options option.DNSOptions, outboundExists func(tag string) bool) {
+	servers := make(map[string]bool)
+	for i, server := range options.Servers {
+		path := F.ToString("dns.servers[", i, "]")
+		tag := server.Tag
+		if tag == "" {
+			tag = F.ToString(i)
+		}
+		if servers[tag] {
+			c.addf(path+".tag", "duplicate dns server tag: ", tag)
+		}
+		servers[tag] = true
+		if server.Detour != "" && !outboundExists(server.Detour) {
+			c.addf(path+".detour", "outbound not found: ", server.Detour)
+		}
+	}
+	for i := range options.Servers {
+		_, err := dnsResolverChain(options.Servers, i)
+		if err != nil {
+			c.add(F.ToString("dns.servers[", i, "]"), err)
+		}
+	}
+	for i, rule := range options.Rules {
+		path := F.ToString("dns.rules[", i, "]")
+		var server string
+		switch rule.Type {
+		case "", C.RuleTypeDefault:
+			c.checkCIDR(path+".source_ip_cidr", rule.DefaultOptions.SourceIPCIDR)
+			server = rule.DefaultOptions.Server
+		case C.RuleTypeLogical:
+			for j, subRule := range rule.LogicalOptions.Rules {
+				c.checkCIDR(F.ToString(path, ".rules[", j, "].source_ip_cidr"), subRule.SourceIPCIDR)
+			}
+			server = rule.LogicalOptions.Server
+		default:
+			c.addf(path+".type", "unknown rule type: ", rule.Type)
+			continue
+		}
+		if server == "" {
+			c.addf(path+".server", "missing server")
+		} else if !servers[server] {
+			c.addf(path+".server", "dns server not found: ", server)
+		}
+	}
+	if options.Final != "" && !servers[options.Final] {
+		c.addf("dns.final", "dns server not found: ", options.Final)
+	}
+}
+
+func (c *checker) checkCIDR(path string, prefixes []string) {
+	for i, prefix := range prefixes {
+		if _, err := netip.ParsePrefix(prefix); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(prefix); err == nil {
+			continue
+		}
+		c.addf(F.ToString(path, "[", i, "]"), "invalid ip cidr: ", prefix)
+	}
+}
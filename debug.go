@@ -0,0 +1,41 @@
+package box
+
+import (
+	"github.com/sagernet/sing-box/option"
+)
+
+// PlatformDebugOptions may be implemented by a platform.Interface to tune
+// the runtime for the device class it runs on, for example a lower memory
+// limit and a more aggressive GC percent on mobile. Fields set in the
+// returned options override experimental.debug from the configuration.
+type PlatformDebugOptions interface {
+	DebugOptions() option.DebugOptions
+}
+
+func mergeDebugOptions(options option.DebugOptions, override option.DebugOptions) option.DebugOptions {
+	if override.Listen != "" {
+		options.Listen = override.Listen
+	}
+	if override.GCPercent != nil {
+		options.GCPercent = override.GCPercent
+	}
+	if override.MaxStack != nil {
+		options.MaxStack = override.MaxStack
+	}
+	if override.MaxThreads != nil {
+		options.MaxThreads = override.MaxThreads
+	}
+	if override.PanicOnFault != nil {
+		options.PanicOnFault = override.PanicOnFault
+	}
+	if override.TraceBack != "" {
+		options.TraceBack = override.TraceBack
+	}
+	if override.MemoryLimit != 0 {
+		options.MemoryLimit = override.MemoryLimit
+	}
+	if override.OOMKiller != nil {
+		options.OOMKiller = override.OOMKiller
+	}
+	return options
+}
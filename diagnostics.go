@@ -0,0 +1,62 @@
+package box
+
+import (
+	"archive/zip"
+	"io"
+	"runtime/pprof"
+	"time"
+
+	"github.com/sagernet/sing-box/common/badjson"
+	"github.com/sagernet/sing-box/common/json"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+)
+
+// Diagnostics writes a zip archive with goroutine and heap profiles, the
+// connection and panic counters and the most recent recovered panics.
+// Only panics recovered while routing a connection are recorded.
+func (s *Box) Diagnostics(writer io.Writer) error {
+	archive := zip.NewWriter(writer)
+	for _, profile := range []struct {
+		name     string
+		fileName string
+		debug    int
+	}{
+		{"goroutine", "goroutine.txt", 2},
+		{"heap", "heap.pprof", 0},
+	} {
+		file, err := archive.Create(profile.fileName)
+		if err != nil {
+			return err
+		}
+		err = pprof.Lookup(profile.name).WriteTo(file, profile.debug)
+		if err != nil {
+			return E.Cause(err, "write ", profile.name, " profile")
+		}
+	}
+	var status badjson.JSONObject
+	status.Put("uptime", F.Seconds(time.Since(s.createdAt).Seconds()))
+	status.Put("connections", s.trackedRouter.Connections())
+	status.Put("panics", s.trackedRouter.Panics())
+	file, err := archive.Create("status.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(&status)
+	if err != nil {
+		return err
+	}
+	file, err = archive.Create("panics.txt")
+	if err != nil {
+		return err
+	}
+	for _, record := range s.trackedRouter.RecentPanics() {
+		_, err = io.WriteString(file, F.ToString(record.time.Format(time.RFC3339), " ", record.metadata, ": ", record.value, "\n", string(record.stack), "\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
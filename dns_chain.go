@@ -0,0 +1,71 @@
+package box
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+)
+
+func dnsServerTag(servers []option.DNSServerOptions, index int) string {
+	if servers[index].Tag != "" {
+		return servers[index].Tag
+	}
+	return F.ToString(index)
+}
+
+// dnsResolverChain follows address_resolver from the server at index and
+// returns the indexes of every server involved, starting with the server
+// itself.
+func dnsResolverChain(servers []option.DNSServerOptions, index int) ([]int, error) {
+	indexByTag := make(map[string]int, len(servers))
+	for i := range servers {
+		indexByTag[dnsServerTag(servers, i)] = i
+	}
+	chain := []int{index}
+	visited := map[int]bool{index: true}
+	for servers[index].AddressResolver != "" {
+		resolver := servers[index].AddressResolver
+		next, loaded := indexByTag[resolver]
+		if !loaded {
+			return nil, E.New("address_resolver: dns server not found: ", resolver)
+		}
+		chain = append(chain, next)
+		if visited[next] {
+			return nil, E.New("address_resolver cycle: ", strings.Join(common.Map(chain, func(it int) string {
+				return dnsServerTag(servers, it)
+			}), " -> "))
+		}
+		visited[next] = true
+		index = next
+	}
+	return chain, nil
+}
+
+func validateDNSServers(logger log.ContextLogger, servers []option.DNSServerOptions, outboundExists func(tag string) bool) error {
+	for i, server := range servers {
+		chain, err := dnsResolverChain(servers, i)
+		if err != nil {
+			return E.Cause(err, "dns server[", i, "]")
+		}
+		if server.Detour != "" && !outboundExists(server.Detour) {
+			return E.New("dns server[", i, "]: detour: outbound not found: ", server.Detour)
+		}
+		if len(chain) == 1 && server.Detour == "" {
+			continue
+		}
+		// every server in the chain dials through its own detour
+		hops := common.Map(chain, func(it int) string {
+			detour := servers[it].Detour
+			if detour == "" {
+				return F.ToString(dnsServerTag(servers, it), " (via default outbound)")
+			}
+			return F.ToString(dnsServerTag(servers, it), " (via outbound ", detour, ")")
+		})
+		logger.Info("dns/", dnsServerTag(servers, i), ": chain ", strings.Join(hops, " -> "))
+	}
+	return nil
+}
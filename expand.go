@@ -0,0 +1,106 @@
+package box
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sagernet/sing-box/common/json"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+// ExpandEnv returns a copy of options with references in string values
+// replaced: ${NAME} by the environment variable NAME and ${file:PATH} by
+// the content of PATH without trailing newlines. A literal "${" is written
+// as "$${". Referencing an unset variable is an error. Inbounds and
+// outbounds of registered types are left untouched.
+func ExpandEnv(options option.Options) (option.Options, error) {
+	options, custom := splitCustomOptions(options)
+	content, err := json.Marshal(options)
+	if err != nil {
+		return option.Options{}, E.Cause(err, "encode config")
+	}
+	var object any
+	err = json.Unmarshal(content, &object)
+	if err != nil {
+		return option.Options{}, E.Cause(err, "decode config")
+	}
+	object, err = expandValue(object)
+	if err != nil {
+		return option.Options{}, err
+	}
+	content, err = json.Marshal(object)
+	if err != nil {
+		return option.Options{}, E.Cause(err, "encode expanded config")
+	}
+	var expanded option.Options
+	err = json.Unmarshal(content, &expanded)
+	if err != nil {
+		return option.Options{}, E.Cause(err, "decode expanded config")
+	}
+	return custom.restore(expanded), nil
+}
+
+func expandValue(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return expandString(v)
+	case map[string]any:
+		for key, item := range v {
+			expanded, err := expandValue(item)
+			if err != nil {
+				return nil, E.Cause(err, key)
+			}
+			v[key] = expanded
+		}
+	case []any:
+		for i, item := range v {
+			expanded, err := expandValue(item)
+			if err != nil {
+				return nil, E.Cause(err, "[", i, "]")
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+func expandString(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+	var builder strings.Builder
+	for {
+		index := strings.Index(value, "${")
+		if index < 0 {
+			builder.WriteString(value)
+			return builder.String(), nil
+		}
+		if index > 0 && value[index-1] == '$' {
+			builder.WriteString(value[:index-1])
+			builder.WriteString("${")
+			value = value[index+2:]
+			continue
+		}
+		end := strings.IndexByte(value[index:], '}')
+		if end < 0 {
+			return "", E.New("unterminated reference: ", value[index:])
+		}
+		builder.WriteString(value[:index])
+		reference := value[index+2 : index+end]
+		value = value[index+end+1:]
+		if strings.HasPrefix(reference, "file:") {
+			content, err := os.ReadFile(strings.TrimPrefix(reference, "file:"))
+			if err != nil {
+				return "", E.Cause(err, "read secret file")
+			}
+			builder.WriteString(strings.TrimRight(string(content), "\r\n"))
+			continue
+		}
+		envValue, loaded := os.LookupEnv(reference)
+		if !loaded {
+			return "", E.New("environment variable not set: ", reference)
+		}
+		builder.WriteString(envValue)
+	}
+}
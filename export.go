@@ -0,0 +1,122 @@
+package box
+
+import (
+	"bytes"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/common/json"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+const redactedValue = "<redacted>"
+
+var redactedKeys = map[string]bool{
+	"auth":                   true,
+	"auth_str":               true,
+	"headers":                true,
+	"key":                    true,
+	"mac_key":                true,
+	"obfs":                   true,
+	"password":               true,
+	"pre_shared_key":         true,
+	"private_key":            true,
+	"private_key_passphrase": true,
+	"secret":                 true,
+	"short_id":               true,
+	"token":                  true,
+	"uuid":                   true,
+}
+
+// ExportConfig returns the options the box was created with as indented
+// JSON. This is not the fully effective configuration: outbounds currently
+// created by proxy providers are appended with their type and tag only, and
+// unset options are not filled with their defaults. When redact is set,
+// credentials such as passwords, UUIDs, private keys, transport headers and
+// proxy provider URLs are masked, keeping the shape of the masked values.
+func (s *Box) ExportConfig(redact bool) ([]byte, error) {
+	var providerOutbounds []adapter.Outbound
+	for _, provider := range s.proxyProviders {
+		outbounds, err := provider.GetOutbounds()
+		if err != nil {
+			return nil, E.Cause(err, "get outbounds from proxy provider ", provider.Tag())
+		}
+		providerOutbounds = append(providerOutbounds, outbounds...)
+	}
+	return encodeOptions(s.options, providerOutbounds, redact)
+}
+
+func encodeOptions(options option.Options, providerOutbounds []adapter.Outbound, redact bool) ([]byte, error) {
+	options, custom := splitCustomOptions(options)
+	content, err := json.Marshal(options)
+	if err != nil {
+		return nil, E.Cause(err, "encode config")
+	}
+	var object map[string]any
+	err = json.Unmarshal(content, &object)
+	if err != nil {
+		return nil, E.Cause(err, "decode config")
+	}
+	custom.restoreObject(object)
+	if len(providerOutbounds) > 0 {
+		items, _ := object["outbounds"].([]any)
+		for _, out := range providerOutbounds {
+			items = append(items, map[string]any{"type": out.Type(), "tag": out.Tag()})
+		}
+		object["outbounds"] = items
+	}
+	if redact {
+		redactValue(object)
+		// subscription URLs usually embed an access token
+		providers, _ := object["proxyproviders"].([]any)
+		for _, provider := range providers {
+			if providerObject, isObject := provider.(map[string]any); isObject && providerObject["url"] != nil {
+				providerObject["url"] = redactedValue
+			}
+		}
+	}
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(object)
+	if err != nil {
+		return nil, E.Cause(err, "encode config")
+	}
+	return buffer.Bytes(), nil
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if redactedKeys[key] {
+				v[key] = maskValue(item)
+			} else {
+				v[key] = redactValue(item)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+// maskValue replaces every string in value, so that a redacted list or
+// object still decodes as the same option type.
+func maskValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return redactedValue
+	case map[string]any:
+		for key, item := range v {
+			v[key] = maskValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = maskValue(item)
+		}
+	}
+	return value
+}
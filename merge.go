@@ -0,0 +1,210 @@
+package box
+
+import (
+	"bytes"
+
+	"github.com/sagernet/sing-box/common/json"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing/common"
+	E "github.com/sagernet/sing/common/exceptions"
+)
+
+// Merge deep-merges configuration fragments in order. Objects are merged
+// recursively and later scalar values win, except that fields left at their
+// zero value are not encoded and so can not override an earlier value: a
+// fragment can not turn a boolean off or clear a string. Use MergeJSON to
+// merge the configuration files themselves instead. Arrays of scalars, such as the
+// members of a selector, are replaced as a whole. In arrays of objects, an
+// item that carries a tag, such as an inbound, outbound or DNS server, is
+// merged into the item with the same tag, which must have the same type,
+// while all other items are appended. Inbounds and outbounds of registered
+// types replace the item with the same tag as a whole and are appended after
+// the built-in ones.
+func Merge(fragments ...option.Options) (option.Options, error) {
+	var merged any
+	var customInbounds []option.Inbound
+	var customOutbounds []option.Outbound
+	for i, fragment := range fragments {
+		var custom customOptions
+		fragment, custom = splitCustomOptions(fragment)
+		var err error
+		customInbounds, err = mergeCustom(customInbounds, custom.inbounds, func(it option.Inbound) (string, string) {
+			return it.Tag, it.Type
+		})
+		if err != nil {
+			return option.Options{}, E.Cause(err, "merge fragment[", i, "]: inbounds")
+		}
+		customOutbounds, err = mergeCustom(customOutbounds, custom.outbounds, func(it option.Outbound) (string, string) {
+			return it.Tag, it.Type
+		})
+		if err != nil {
+			return option.Options{}, E.Cause(err, "merge fragment[", i, "]: outbounds")
+		}
+		content, err := json.Marshal(fragment)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "encode fragment[", i, "]")
+		}
+		var object any
+		err = json.Unmarshal(content, &object)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "decode fragment[", i, "]")
+		}
+		merged, err = mergeValue(merged, object)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "merge fragment[", i, "]")
+		}
+	}
+	var options option.Options
+	if merged != nil {
+		content, err := json.Marshal(merged)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "encode merged config")
+		}
+		err = json.Unmarshal(content, &options)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "decode merged config")
+		}
+	}
+	for _, inboundOptions := range customInbounds {
+		if inboundOptions.Tag != "" && common.Any(options.Inbounds, func(it option.Inbound) bool {
+			return it.Tag == inboundOptions.Tag
+		}) {
+			return option.Options{}, E.New("conflicting type for inbound tag ", inboundOptions.Tag)
+		}
+	}
+	for _, outboundOptions := range customOutbounds {
+		if outboundOptions.Tag != "" && common.Any(options.Outbounds, func(it option.Outbound) bool {
+			return it.Tag == outboundOptions.Tag
+		}) {
+			return option.Options{}, E.New("conflicting type for outbound tag ", outboundOptions.Tag)
+		}
+	}
+	options.Inbounds = append(options.Inbounds, customInbounds...)
+	options.Outbounds = append(options.Outbounds, customOutbounds...)
+	return options, nil
+}
+
+// MergeJSON merges configuration files the same way as Merge, but before
+// decoding them, so that explicit false, zero and empty values override
+// earlier ones. Comments are allowed as in a configuration file.
+func MergeJSON(fragments ...[]byte) (option.Options, error) {
+	var merged any
+	for i, fragment := range fragments {
+		var object any
+		decoder := json.NewDecoder(json.NewCommentFilter(bytes.NewReader(fragment)))
+		err := decoder.Decode(&object)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "decode fragment[", i, "]")
+		}
+		merged, err = mergeValue(merged, object)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "merge fragment[", i, "]")
+		}
+	}
+	var options option.Options
+	if merged != nil {
+		content, err := json.Marshal(merged)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "encode merged config")
+		}
+		err = json.Unmarshal(content, &options)
+		if err != nil {
+			return option.Options{}, E.Cause(err, "decode merged config")
+		}
+	}
+	return options, nil
+}
+
+func mergeCustom[T any](items []T, newItems []T, tagType func(it T) (string, string)) ([]T, error) {
+	for _, item := range newItems {
+		tag, itemType := tagType(item)
+		index := -1
+		if tag != "" {
+			for i, it := range items {
+				if itTag, _ := tagType(it); itTag == tag {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 {
+			items = append(items, item)
+			continue
+		}
+		if _, currentType := tagType(items[index]); currentType != itemType {
+			return nil, E.New("conflicting type for tag ", tag, ": ", currentType, " and ", itemType)
+		}
+		items[index] = item
+	}
+	return items, nil
+}
+
+func mergeValue(destination any, source any) (any, error) {
+	switch sourceValue := source.(type) {
+	case map[string]any:
+		destinationValue, isObject := destination.(map[string]any)
+		if !isObject {
+			return sourceValue, nil
+		}
+		for key, value := range sourceValue {
+			merged, err := mergeValue(destinationValue[key], value)
+			if err != nil {
+				return nil, E.Cause(err, key)
+			}
+			destinationValue[key] = merged
+		}
+		return destinationValue, nil
+	case []any:
+		destinationValue, isArray := destination.([]any)
+		if !isArray || !isObjectArray(sourceValue) {
+			return sourceValue, nil
+		}
+		for _, item := range sourceValue {
+			index := taggedItemIndex(destinationValue, item)
+			if index < 0 {
+				destinationValue = append(destinationValue, item)
+				continue
+			}
+			destinationItem := destinationValue[index].(map[string]any)
+			sourceItem := item.(map[string]any)
+			destinationType, sourceType := destinationItem["type"], sourceItem["type"]
+			if destinationType != nil && sourceType != nil && destinationType != sourceType {
+				return nil, E.New("conflicting type for tag ", sourceItem["tag"], ": ", destinationType, " and ", sourceType)
+			}
+			merged, err := mergeValue(destinationItem, sourceItem)
+			if err != nil {
+				return nil, E.Cause(err, "[", sourceItem["tag"], "]")
+			}
+			destinationValue[index] = merged
+		}
+		return destinationValue, nil
+	default:
+		return source, nil
+	}
+}
+
+func isObjectArray(items []any) bool {
+	for _, item := range items {
+		if _, isObject := item.(map[string]any); !isObject {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+func taggedItemIndex(items []any, item any) int {
+	object, isObject := item.(map[string]any)
+	if !isObject {
+		return -1
+	}
+	tag, isString := object["tag"].(string)
+	if !isString || tag == "" {
+		return -1
+	}
+	for i, it := range items {
+		if itObject, isObject := it.(map[string]any); isObject && itObject["tag"] == tag {
+			return i
+		}
+	}
+	return -1
+}
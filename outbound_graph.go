@@ -0,0 +1,210 @@
+package box
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/common/json"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+)
+
+type outboundDependency struct {
+	field string
+	// index is the position in a list field such as outbounds, or -1
+	index int
+	tag   string
+}
+
+// path returns the JSON path of the dependency relative to its outbound.
+func (d outboundDependency) path() string {
+	if d.index < 0 {
+		return d.field
+	}
+	return F.ToString(d.field, "[", d.index, "]")
+}
+
+type outboundNode struct {
+	index        int
+	outboundType string
+	tag          string
+	dependencies []outboundDependency
+}
+
+func (n *outboundNode) String() string {
+	return F.ToString("outbound/", n.outboundType, "[", n.tag, "]")
+}
+
+type outboundGraph struct {
+	nodes     []*outboundNode
+	nodeByTag map[string]*outboundNode
+}
+
+func newOutboundGraph(outbounds []option.Outbound) (*outboundGraph, error) {
+	graph := &outboundGraph{
+		nodeByTag: make(map[string]*outboundNode),
+	}
+	for i, outboundOptions := range outbounds {
+		err := graph.add(i, outboundOptions)
+		if err != nil {
+			return nil, E.Cause(err, "parse outbound[", i, "]")
+		}
+	}
+	return graph, nil
+}
+
+func outboundTag(options option.Outbound, index int) string {
+	if options.Tag != "" {
+		return options.Tag
+	}
+	return F.ToString(index)
+}
+
+func (g *outboundGraph) add(index int, options option.Outbound) error {
+	tag := outboundTag(options, index)
+	if _, loaded := g.nodeByTag[tag]; loaded {
+		return E.New("duplicate outbound tag: ", tag)
+	}
+	dependencies, err := outboundDependencies(options)
+	if err != nil {
+		return err
+	}
+	node := &outboundNode{
+		index:        index,
+		outboundType: options.Type,
+		tag:          tag,
+		dependencies: dependencies,
+	}
+	g.nodes = append(g.nodes, node)
+	g.nodeByTag[tag] = node
+	return nil
+}
+
+func outboundDependencies(options option.Outbound) ([]outboundDependency, error) {
+	if isRegisteredOutbound(options.Type) {
+		return nil, nil
+	}
+	var dependencies []outboundDependency
+	switch options.Type {
+	case C.TypeSelector:
+		for i, tag := range options.SelectorOptions.Outbounds {
+			dependencies = append(dependencies, outboundDependency{"outbounds", i, tag})
+		}
+		if options.SelectorOptions.Default != "" {
+			dependencies = append(dependencies, outboundDependency{"default", -1, options.SelectorOptions.Default})
+		}
+	case C.TypeURLTest:
+		for i, tag := range options.URLTestOptions.Outbounds {
+			dependencies = append(dependencies, outboundDependency{"outbounds", i, tag})
+		}
+	}
+	// dialer options are embedded in every protocol struct, so read the
+	// detour back from the flattened JSON form instead of switching on type
+	content, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]any
+	err = json.Unmarshal(content, &object)
+	if err != nil {
+		return nil, err
+	}
+	if detour, isString := object["detour"].(string); isString && detour != "" {
+		dependencies = append(dependencies, outboundDependency{"detour", -1, detour})
+	}
+	return dependencies, nil
+}
+
+// Validate checks that every detour, group member and selector default
+// refers to a known outbound and that no outbound transitively depends on itself.
+// externalTags are outbounds created outside the options, such as
+// proxy provider nodes, which are treated as having no dependencies.
+func (g *outboundGraph) Validate(externalTags []string) error {
+	external := make(map[string]bool, len(externalTags))
+	for _, tag := range externalTags {
+		external[tag] = true
+	}
+	for _, node := range g.nodes {
+		for _, dependency := range node.dependencies {
+			if g.nodeByTag[dependency.tag] == nil && !external[dependency.tag] {
+				return E.New(node, ": ", dependency.path(), ": outbound not found: ", dependency.tag)
+			}
+		}
+	}
+	return g.visit(func(*outboundNode) {})
+}
+
+// Order returns the indices of all outbounds such that every outbound comes
+// after the outbounds it depends on.
+func (g *outboundGraph) Order() ([]int, error) {
+	order := make([]int, 0, len(g.nodes))
+	err := g.visit(func(node *outboundNode) {
+		order = append(order, node.index)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+type outboundCycleError struct {
+	// node is the first outbound of the cycle
+	node  *outboundNode
+	cycle []string
+}
+
+func (e *outboundCycleError) Error() string {
+	return "outbound dependency cycle: " + strings.Join(e.cycle, " -> ")
+}
+
+// visit walks the graph depth first, calling fn for each node after all of
+// its dependencies, and returns an error describing the first cycle found.
+func (g *outboundGraph) visit(fn func(node *outboundNode)) error {
+	const (
+		stateVisiting = iota + 1
+		stateDone
+	)
+	state := make(map[*outboundNode]int, len(g.nodes))
+	var path []*outboundNode
+	var walk func(node *outboundNode) error
+	walk = func(node *outboundNode) error {
+		switch state[node] {
+		case stateDone:
+			return nil
+		case stateVisiting:
+			var cycle []string
+			for i := len(path) - 1; i >= 0; i-- {
+				cycle = append([]string{path[i].tag}, cycle...)
+				if path[i] == node {
+					break
+				}
+			}
+			cycle = append(cycle, node.tag)
+			return &outboundCycleError{node, cycle}
+		}
+		state[node] = stateVisiting
+		path = append(path, node)
+		for _, dependency := range node.dependencies {
+			next := g.nodeByTag[dependency.tag]
+			if next == nil {
+				continue
+			}
+			err := walk(next)
+			if err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = stateDone
+		fn(node)
+		return nil
+	}
+	for _, node := range g.nodes {
+		err := walk(node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package box
+
+// Pauser may be implemented by components with background work that should
+// be suspended while the device is idle. Pause and Resume only reach
+// components that implement it; none of the built-in outbounds, proxy
+// providers or dialers do yet.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// Pause calls Pause on the router, services, inbounds, outbounds and proxy
+// providers that implement Pauser. Listeners are left open.
+func (s *Box) Pause() {
+	s.pauseAccess.Lock()
+	defer s.pauseAccess.Unlock()
+	if s.paused {
+		return
+	}
+	s.paused = true
+	for _, component := range s.pausers() {
+		component.Pause()
+	}
+	s.logger.Info("paused")
+}
+
+// Resume calls Resume on the components paused by Pause.
+func (s *Box) Resume() {
+	s.pauseAccess.Lock()
+	defer s.pauseAccess.Unlock()
+	if !s.paused {
+		return
+	}
+	s.paused = false
+	for _, component := range s.pausers() {
+		component.Resume()
+	}
+	s.logger.Info("resumed")
+}
+
+func (s *Box) pausers() []Pauser {
+	var components []any
+	components = append(components, s.router)
+	for _, service := range s.preServices {
+		components = append(components, service)
+	}
+	for _, service := range s.postServices {
+		components = append(components, service)
+	}
+	for _, in := range s.inbounds {
+		components = append(components, in)
+	}
+	for _, out := range s.outbounds {
+		components = append(components, out)
+	}
+	for _, provider := range s.proxyProviders {
+		components = append(components, provider)
+	}
+	var pausers []Pauser
+	for _, component := range components {
+		if pauser, isPauser := component.(Pauser); isPauser {
+			pausers = append(pausers, pauser)
+		}
+	}
+	return pausers
+}
@@ -0,0 +1,179 @@
+package box
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/experimental/libbox/platform"
+	"github.com/sagernet/sing-box/inbound"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/outbound"
+	"github.com/sagernet/sing-dns"
+	"github.com/sagernet/sing/common"
+)
+
+type (
+	InboundConstructor  func(ctx context.Context, router adapter.Router, logger log.ContextLogger, options option.Inbound, platformInterface platform.Interface) (adapter.Inbound, error)
+	OutboundConstructor func(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.Outbound) (adapter.Outbound, error)
+)
+
+var (
+	registryAccess   sync.RWMutex
+	inboundRegistry  = make(map[string]InboundConstructor)
+	outboundRegistry = make(map[string]OutboundConstructor)
+)
+
+// RegisterInbound makes New use constructor for inbounds of inboundType,
+// taking precedence over built-in types.
+//
+// The option package only knows built-in types, so custom types are only
+// usable from options built in Go, and option.Inbound has no field for
+// their settings: the constructor has to capture them itself until an
+// extension field is added there. Check, Merge, ExpandEnv and ExportConfig
+// pass inbounds of registered types through without looking inside them.
+func RegisterInbound(inboundType string, constructor InboundConstructor) {
+	registryAccess.Lock()
+	defer registryAccess.Unlock()
+	inboundRegistry[inboundType] = constructor
+}
+
+// RegisterOutbound makes New use constructor for outbounds of outboundType,
+// with the same precedence and limits as RegisterInbound. Detours of
+// registered outbounds are unknown, so they are not part of dependency
+// validation and start ordering.
+func RegisterOutbound(outboundType string, constructor OutboundConstructor) {
+	registryAccess.Lock()
+	defer registryAccess.Unlock()
+	outboundRegistry[outboundType] = constructor
+}
+
+// RegisterDNSTransport makes DNS server addresses with one of schemes use
+// constructor. The transport registry of the dns package is not guarded
+// against concurrent use, so unlike the other Register functions it must be
+// called before any New, typically from an init function.
+func RegisterDNSTransport(schemes []string, constructor dns.TransportConstructor) {
+	registryAccess.Lock()
+	defer registryAccess.Unlock()
+	dns.RegisterTransport(schemes, constructor)
+}
+
+func newInbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, options option.Inbound, platformInterface platform.Interface) (adapter.Inbound, error) {
+	registryAccess.RLock()
+	constructor, loaded := inboundRegistry[options.Type]
+	registryAccess.RUnlock()
+	if loaded {
+		return constructor(ctx, router, logger, options, platformInterface)
+	}
+	return inbound.New(ctx, router, logger, options, platformInterface)
+}
+
+func newOutbound(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.Outbound) (adapter.Outbound, error) {
+	registryAccess.RLock()
+	constructor, loaded := outboundRegistry[options.Type]
+	registryAccess.RUnlock()
+	if loaded {
+		return constructor(ctx, router, logger, tag, options)
+	}
+	return outbound.New(ctx, router, logger, tag, options)
+}
+
+func isRegisteredInbound(inboundType string) bool {
+	registryAccess.RLock()
+	defer registryAccess.RUnlock()
+	return inboundRegistry[inboundType] != nil
+}
+
+func isRegisteredOutbound(outboundType string) bool {
+	registryAccess.RLock()
+	defer registryAccess.RUnlock()
+	return outboundRegistry[outboundType] != nil
+}
+
+// customOptions holds the inbounds and outbounds of registered types taken
+// out of options by splitCustomOptions, since the option package can not
+// encode them, together with their original indexes.
+type customOptions struct {
+	inboundIndexes  []int
+	inbounds        []option.Inbound
+	outboundIndexes []int
+	outbounds       []option.Outbound
+}
+
+func splitCustomOptions(options option.Options) (option.Options, customOptions) {
+	var custom customOptions
+	var inbounds []option.Inbound
+	for i, inboundOptions := range options.Inbounds {
+		if isRegisteredInbound(inboundOptions.Type) {
+			custom.inboundIndexes = append(custom.inboundIndexes, i)
+			custom.inbounds = append(custom.inbounds, inboundOptions)
+		} else {
+			inbounds = append(inbounds, inboundOptions)
+		}
+	}
+	if len(custom.inbounds) > 0 {
+		options.Inbounds = inbounds
+	}
+	var outbounds []option.Outbound
+	for i, outboundOptions := range options.Outbounds {
+		if isRegisteredOutbound(outboundOptions.Type) {
+			custom.outboundIndexes = append(custom.outboundIndexes, i)
+			custom.outbounds = append(custom.outbounds, outboundOptions)
+		} else {
+			outbounds = append(outbounds, outboundOptions)
+		}
+	}
+	if len(custom.outbounds) > 0 {
+		options.Outbounds = outbounds
+	}
+	return options, custom
+}
+
+// restore puts the custom inbounds and outbounds back at their indexes.
+func (c customOptions) restore(options option.Options) option.Options {
+	options.Inbounds = insertAt(options.Inbounds, c.inboundIndexes, c.inbounds)
+	options.Outbounds = insertAt(options.Outbounds, c.outboundIndexes, c.outbounds)
+	return options
+}
+
+// restoreObject puts placeholders carrying only type and tag for the custom
+// inbounds and outbounds into the JSON form of the remaining options.
+func (c customOptions) restoreObject(object map[string]any) {
+	placeholder := func(optionsType string, tag string) any {
+		item := map[string]any{"type": optionsType}
+		if tag != "" {
+			item["tag"] = tag
+		}
+		return item
+	}
+	if len(c.inbounds) > 0 {
+		items, _ := object["inbounds"].([]any)
+		object["inbounds"] = insertAt(items, c.inboundIndexes, common.Map(c.inbounds, func(it option.Inbound) any {
+			return placeholder(it.Type, it.Tag)
+		}))
+	}
+	if len(c.outbounds) > 0 {
+		items, _ := object["outbounds"].([]any)
+		object["outbounds"] = insertAt(items, c.outboundIndexes, common.Map(c.outbounds, func(it option.Outbound) any {
+			return placeholder(it.Type, it.Tag)
+		}))
+	}
+}
+
+func insertAt[T any](items []T, indexes []int, inserted []T) []T {
+	if len(inserted) == 0 {
+		return items
+	}
+	result := make([]T, 0, len(items)+len(inserted))
+	for len(items) > 0 || len(inserted) > 0 {
+		if len(inserted) > 0 && (indexes[0] <= len(result) || len(items) == 0) {
+			result = append(result, inserted[0])
+			indexes, inserted = indexes[1:], inserted[1:]
+		} else {
+			result = append(result, items[0])
+			items = items[1:]
+		}
+	}
+	return result
+}
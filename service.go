@@ -0,0 +1,200 @@
+package box
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/log"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+type ServiceOptions struct {
+	Options
+	// Reload returns the options to restart with on reload. When nil, the
+	// box is restarted with the current options.
+	Reload func() (Options, error)
+	// ShutdownTimeout limits how long active connections are drained.
+	ShutdownTimeout time.Duration
+	// DiagnosticsDirectory is where diagnostics bundles are written,
+	// defaulting to the system temporary directory.
+	DiagnosticsDirectory string
+}
+
+type serviceEvent int
+
+const (
+	serviceEventReload serviceEvent = iota
+	serviceEventShutdown
+	serviceEventDiagnostics
+)
+
+// serviceEvents delivers events to runService. A reload or diagnostics
+// request arriving while the same kind is pending is merged into it, while a
+// shutdown request is latched so that it is never lost, even in the middle
+// of a reload.
+type serviceEvents struct {
+	reload       chan struct{}
+	diagnostics  chan struct{}
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+func newServiceEvents() *serviceEvents {
+	return &serviceEvents{
+		reload:      make(chan struct{}, 1),
+		diagnostics: make(chan struct{}, 1),
+		shutdown:    make(chan struct{}),
+	}
+}
+
+func (e *serviceEvents) Send(event serviceEvent) {
+	var pending chan struct{}
+	switch event {
+	case serviceEventShutdown:
+		e.shutdownOnce.Do(func() {
+			close(e.shutdown)
+		})
+		return
+	case serviceEventReload:
+		pending = e.reload
+	case serviceEventDiagnostics:
+		pending = e.diagnostics
+	}
+	select {
+	case pending <- struct{}{}:
+	default:
+	}
+}
+
+func (e *serviceEvents) ShuttingDown() bool {
+	select {
+	case <-e.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+func forwardSignals(ctx context.Context, events *serviceEvents, signalEvents map[os.Signal]serviceEvent) {
+	signals := make(chan os.Signal, 1)
+	for sig := range signalEvents {
+		signal.Notify(signals, sig)
+	}
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				events.Send(signalEvents[sig])
+			}
+		}
+	}()
+}
+
+// runService starts a box and drives it by events until it is shut down or
+// ctx is done.
+func runService(ctx context.Context, options ServiceOptions, events *serviceEvents) error {
+	if options.ShutdownTimeout == 0 {
+		options.ShutdownTimeout = defaultShutdownTimeout
+	}
+	instance, err := startService(options.Options)
+	if err != nil {
+		return err
+	}
+	for {
+		if events.ShuttingDown() {
+			return shutdownService(instance, options)
+		}
+		select {
+		case <-ctx.Done():
+			return shutdownService(instance, options)
+		case <-events.shutdown:
+			return shutdownService(instance, options)
+		case <-events.reload:
+			newOptions := options.Options
+			if options.Reload != nil {
+				newOptions, err = options.Reload()
+				if err != nil {
+					instance.logger.Error(E.Cause(err, "reload"))
+					continue
+				}
+			}
+			err = Check(newOptions)
+			if err != nil {
+				instance.logger.Error(E.Cause(err, "reload"))
+				continue
+			}
+			instance.logger.Info("reloading")
+			// clients reconnect right away, so a reload does not wait for
+			// active connections the way a shutdown does
+			err = instance.Close()
+			if events.ShuttingDown() || ctx.Err() != nil {
+				return err
+			}
+			if err != nil {
+				log.Error(E.Cause(err, "close"))
+			}
+			instance, err = startService(newOptions)
+			if err != nil {
+				log.Error(E.Cause(err, "reload"), ", restarting with the previous options")
+				instance, err = startService(options.Options)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			options.Options = newOptions
+		case <-events.diagnostics:
+			path, err := writeDiagnostics(instance, options.DiagnosticsDirectory)
+			if err != nil {
+				instance.logger.Error(E.Cause(err, "write diagnostics"))
+			} else {
+				instance.logger.Info("diagnostics written to ", path)
+			}
+		}
+	}
+}
+
+func startService(options Options) (*Box, error) {
+	instance, err := New(options)
+	if err != nil {
+		return nil, E.Cause(err, "create service")
+	}
+	err = instance.Start()
+	if err != nil {
+		return nil, E.Cause(err, "start service")
+	}
+	return instance, nil
+}
+
+func shutdownService(instance *Box, options ServiceOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), options.ShutdownTimeout)
+	defer cancel()
+	return instance.Shutdown(ctx)
+}
+
+func writeDiagnostics(instance *Box, directory string) (string, error) {
+	if directory == "" {
+		directory = os.TempDir()
+	}
+	path := filepath.Join(directory, F.ToString("sing-box-diagnostics-", time.Now().Unix(), ".zip"))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	err = instance.Diagnostics(file)
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
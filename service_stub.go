@@ -0,0 +1,21 @@
+//go:build js || plan9
+
+package box
+
+import (
+	"context"
+	"os"
+)
+
+// RunService creates and starts a box, then handles an interrupt by a
+// graceful shutdown. Reload and diagnostics signals are not available on
+// this platform. It returns once the box is shut down or ctx is done.
+func RunService(ctx context.Context, options ServiceOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := newServiceEvents()
+	forwardSignals(ctx, events, map[os.Signal]serviceEvent{
+		os.Interrupt: serviceEventShutdown,
+	})
+	return runService(ctx, options, events)
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !js && !plan9
+
+package box
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+// RunService creates and starts a box, then handles SIGHUP by reloading,
+// SIGINT and SIGTERM by a graceful shutdown and SIGUSR2 by writing a
+// diagnostics bundle. It returns once the box is shut down or ctx is done.
+func RunService(ctx context.Context, options ServiceOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := newServiceEvents()
+	forwardSignals(ctx, events, map[os.Signal]serviceEvent{
+		syscall.SIGHUP:  serviceEventReload,
+		syscall.SIGINT:  serviceEventShutdown,
+		syscall.SIGTERM: serviceEventShutdown,
+		syscall.SIGUSR2: serviceEventDiagnostics,
+	})
+	return runService(ctx, options, events)
+}
@@ -0,0 +1,76 @@
+package box
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// RunService creates and starts a box, then handles Ctrl+C by a graceful
+// shutdown. When running as a Windows service, stop and shutdown requests
+// shut the box down gracefully and parameter change requests reload it.
+// It returns once the box is shut down or ctx is done.
+func RunService(ctx context.Context, options ServiceOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := newServiceEvents()
+	forwardSignals(ctx, events, map[os.Signal]serviceEvent{
+		os.Interrupt:    serviceEventShutdown,
+		syscall.SIGTERM: serviceEventShutdown,
+	})
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return runService(ctx, options, events)
+	}
+	handler := &windowsService{
+		ctx:     ctx,
+		options: options,
+		events:  events,
+	}
+	err = svc.Run("sing-box", handler)
+	if err != nil {
+		return err
+	}
+	return handler.err
+}
+
+type windowsService struct {
+	ctx     context.Context
+	options ServiceOptions
+	events  *serviceEvents
+	err     error
+}
+
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() {
+		done <- runService(s.ctx, s.options, s.events)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange}
+	for {
+		select {
+		case s.err = <-done:
+			status <- svc.Status{State: svc.StopPending}
+			if s.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				s.events.Send(serviceEventShutdown)
+			case svc.ParamChange:
+				s.events.Send(serviceEventReload)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package box
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const (
+	defaultSpeedTestDownloadURL = "https://speed.cloudflare.com/__down?bytes=1000000000"
+	defaultSpeedTestUploadURL   = "https://speed.cloudflare.com/__up"
+	defaultSpeedTestDuration    = 10 * time.Second
+)
+
+type SpeedTestOptions struct {
+	DownloadURL string
+	UploadURL   string
+	// Duration limits each direction separately.
+	Duration time.Duration
+	// SkipUpload only measures the download direction.
+	SkipUpload bool
+}
+
+type SpeedTestResult struct {
+	// Download and Upload are measured in bytes per second.
+	Download uint64
+	Upload   uint64
+}
+
+// SpeedTest measures throughput through the outbound with the given tag by
+// downloading from and uploading to HTTP endpoints for a fixed duration.
+func (s *Box) SpeedTest(ctx context.Context, tag string, options SpeedTestOptions) (*SpeedTestResult, error) {
+	detour, loaded := s.router.Outbound(tag)
+	if !loaded {
+		return nil, E.New("outbound not found: ", tag)
+	}
+	if options.DownloadURL == "" {
+		options.DownloadURL = defaultSpeedTestDownloadURL
+	}
+	if options.UploadURL == "" {
+		options.UploadURL = defaultSpeedTestUploadURL
+	}
+	if options.Duration == 0 {
+		options.Duration = defaultSpeedTestDuration
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return detour.DialContext(ctx, N.NetworkTCP, M.ParseSocksaddr(addr))
+			},
+			DisableCompression: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+	var result SpeedTestResult
+	var err error
+	result.Download, err = speedTestDownload(ctx, client, options)
+	if err != nil {
+		return nil, E.Cause(err, "download test")
+	}
+	if !options.SkipUpload {
+		result.Upload, err = speedTestUpload(ctx, client, options)
+		if err != nil {
+			return nil, E.Cause(err, "upload test")
+		}
+	}
+	return &result, nil
+}
+
+func speedTestDownload(ctx context.Context, client *http.Client, options SpeedTestOptions) (uint64, error) {
+	testCtx, cancel := context.WithTimeout(ctx, options.Duration)
+	defer cancel()
+	request, err := http.NewRequestWithContext(testCtx, http.MethodGet, options.DownloadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, E.New("unexpected status: ", response.Status)
+	}
+	// connection setup and time to first byte are not throughput
+	start := time.Now()
+	n, err := io.Copy(io.Discard, response.Body)
+	// reaching the test duration ends the download, anything else is a failure
+	if err != nil && !(errors.Is(testCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil) {
+		return 0, err
+	}
+	return speedTestBytesPerSecond(n, time.Since(start)), nil
+}
+
+// speedTestUpload relies on the server responding only after it has read
+// the whole body, so that the response acknowledges every byte sent and the
+// elapsed time runs from the first byte until the response arrives rather
+// than until the last byte was buffered for writing.
+func speedTestUpload(ctx context.Context, client *http.Client, options SpeedTestOptions) (uint64, error) {
+	body := &speedTestReader{duration: options.Duration}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, options.UploadURL, body)
+	if err != nil {
+		return 0, err
+	}
+	request.ContentLength = -1
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return 0, E.New("unexpected status: ", response.Status)
+	}
+	start, n, done := body.status()
+	if !done {
+		return 0, E.New("server responded before the upload finished")
+	}
+	return speedTestBytesPerSecond(n, time.Since(start)), nil
+}
+
+func speedTestBytesPerSecond(n int64, elapsed time.Duration) uint64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return uint64(float64(n) / elapsed.Seconds())
+}
+
+// speedTestReader produces zeros for duration from the first read. The
+// transport reads it from its own goroutine, which can outlive client.Do.
+type speedTestReader struct {
+	duration time.Duration
+	access   sync.Mutex
+	start    time.Time
+	n        int64
+	done     bool
+}
+
+func (r *speedTestReader) Read(p []byte) (int, error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	if r.done || time.Since(r.start) >= r.duration {
+		r.done = true
+		return 0, io.EOF
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+func (r *speedTestReader) status() (start time.Time, n int64, done bool) {
+	r.access.Lock()
+	defer r.access.Unlock()
+	return r.start, r.n, r.done
+}
@@ -0,0 +1,99 @@
+package box
+
+import (
+	"context"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/log"
+	E "github.com/sagernet/sing/common/exceptions"
+	F "github.com/sagernet/sing/common/format"
+	N "github.com/sagernet/sing/common/network"
+)
+
+const maxPanicRecords = 16
+
+var _ adapter.Router = (*trackedRouter)(nil)
+
+// trackedRouter is handed to inbounds instead of the router itself to keep
+// count of connections being routed and to recover panics raised while
+// routing them. RouteConnection and RoutePacketConnection only return once
+// the connection is finished.
+//
+// Only the goroutine calling into the router is covered: panics in inbound
+// handshakes and decoding, which run before routing, and in the relay
+// goroutines started by bufio.CopyConn still crash the process. The panic
+// count is only reported by Box.Diagnostics, not exported as a metric.
+type trackedRouter struct {
+	adapter.Router
+	logger      log.ContextLogger
+	connections int64
+	panics      int64
+	panicAccess sync.Mutex
+	panicList   []panicRecord
+}
+
+type panicRecord struct {
+	time     time.Time
+	metadata string
+	value    any
+	stack    []byte
+}
+
+func newTrackedRouter(router adapter.Router, logger log.ContextLogger) *trackedRouter {
+	return &trackedRouter{Router: router, logger: logger}
+}
+
+func (r *trackedRouter) RouteConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext) (err error) {
+	atomic.AddInt64(&r.connections, 1)
+	defer atomic.AddInt64(&r.connections, -1)
+	defer r.recoverPanic(ctx, metadata, &err)
+	return r.Router.RouteConnection(ctx, conn, metadata)
+}
+
+func (r *trackedRouter) RoutePacketConnection(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext) (err error) {
+	atomic.AddInt64(&r.connections, 1)
+	defer atomic.AddInt64(&r.connections, -1)
+	defer r.recoverPanic(ctx, metadata, &err)
+	return r.Router.RoutePacketConnection(ctx, conn, metadata)
+}
+
+func (r *trackedRouter) recoverPanic(ctx context.Context, metadata adapter.InboundContext, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	record := panicRecord{
+		time:     time.Now(),
+		metadata: F.ToString("inbound/", metadata.InboundType, "[", metadata.Inbound, "] ", metadata.Network, " ", metadata.Source, " => ", metadata.Destination),
+		value:    value,
+		stack:    debug.Stack(),
+	}
+	atomic.AddInt64(&r.panics, 1)
+	r.panicAccess.Lock()
+	r.panicList = append(r.panicList, record)
+	if len(r.panicList) > maxPanicRecords {
+		r.panicList = r.panicList[len(r.panicList)-maxPanicRecords:]
+	}
+	r.panicAccess.Unlock()
+	r.logger.ErrorContext(ctx, "panic on connection ", record.metadata, ": ", value, "\n", string(record.stack))
+	*err = E.New("panic: ", value)
+}
+
+func (r *trackedRouter) Connections() int64 {
+	return atomic.LoadInt64(&r.connections)
+}
+
+func (r *trackedRouter) Panics() int64 {
+	return atomic.LoadInt64(&r.panics)
+}
+
+func (r *trackedRouter) RecentPanics() []panicRecord {
+	r.panicAccess.Lock()
+	defer r.panicAccess.Unlock()
+	return append([]panicRecord(nil), r.panicList...)
+}